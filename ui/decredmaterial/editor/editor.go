@@ -4,14 +4,17 @@ package editor
 
 import (
 	"image"
+	"image/color"
 	"io"
 	"math"
+	"sort"
 	"strings"
 	"time"
 	"unicode/utf8"
 
 	"gioui.org/f32"
 	"gioui.org/gesture"
+	"gioui.org/io/clipboard"
 	"gioui.org/io/key"
 	"gioui.org/io/pointer"
 	"gioui.org/layout"
@@ -37,6 +40,14 @@ type Editor struct {
 	Mask         rune
 	maskedReader maskedReader
 
+	// Filter, if set, restricts which runes may be inserted into the
+	// editor; runes for which it returns false are dropped. A nil
+	// Filter accepts everything.
+	Filter FilterFunc
+	// MaxLen caps the number of runes the editor will hold. Insertions
+	// that would exceed it are truncated. Zero means unlimited.
+	MaxLen int
+
 	eventKey     int
 	font         text.Font
 	shaper       text.Shaper
@@ -54,14 +65,45 @@ type Editor struct {
 	caretOn      bool
 	caretScroll  bool
 
-	// carXOff is the offset to the current caret
-	// position when moving between lines.
-	carXOff fixed.Int26_6
+	// car caches the on-screen position of the caret so that CaretPos,
+	// CaretCoords and PaintCaret don't have to re-walk e.lines on every
+	// frame. It is refreshed in makeValid after a layout change, and
+	// updated incrementally by Move, moveToLine, moveStart and moveEnd
+	// otherwise.
+	car caret
+
+	// anchor is the other end of the active selection range. Selection
+	// is empty, i.e. there is no highlighted text, whenever anchor
+	// equals e.rr.caret.
+	anchor int
+	// SelectionColor is the color painted behind selected text by
+	// PaintSelection. Callers that want selection highlighting should
+	// set it, mirroring how Mask is opt-in.
+	SelectionColor color.RGBA
+
+	undo undo
+
+	// pasteRequested is set by Paste and consumed on the next frame to
+	// issue a clipboard.ReadOp.
+	pasteRequested bool
+	// clipboardWrite holds text queued by Copy (which the Ctrl+X cut
+	// command also calls) to be written to the system clipboard on the
+	// next frame.
+	clipboardWrite *string
 
 	scroller  gesture.Scroll
 	scrollOff image.Point
 
 	clicker gesture.Click
+	dragger gesture.Drag
+
+	// highlighter, if set, supplies the Spans PaintText colors the text
+	// with. spans caches its last result; spansValid is cleared whenever
+	// e.rr.Changed() so Highlight is only called again after an actual
+	// edit, not on every frame.
+	highlighter Highlighter
+	spans       []Span
+	spansValid  bool
 
 	// events is the list of events not yet processed.
 	events []Event
@@ -69,6 +111,71 @@ type Editor struct {
 	prevEvents int
 }
 
+// caret is the cached screen position of the insertion point: its line
+// and column within e.lines, its x & y coordinates, and xoff, the
+// horizontal offset remembered across vertical moves (Up/Down/PageUp/
+// PageDown) so that moving through a short line and back to a longer one
+// restores the original column.
+type caret struct {
+	line, col int
+	x         fixed.Int26_6
+	y         int
+	xoff      fixed.Int26_6
+}
+
+// editRecord captures one coalesced, reversible edit: the text that
+// occupied [start, start+len(before)) beforehand and the text that
+// replaced it.
+type editRecord struct {
+	start         int
+	before, after string
+	at            time.Time
+}
+
+// undo is a bounded history of coalesced edits backing Undo/Redo. pos is
+// the index of the next record Redo would reapply; records before it
+// have been applied, records at or after it have been undone.
+type undo struct {
+	records []editRecord
+	pos     int
+}
+
+// maxUndoRecords bounds how many coalesced edits Undo/Redo retains.
+const maxUndoRecords = 100
+
+// undoCoalesceWindow is how soon after the previous edit a same-direction
+// edit must occur to be merged into it, so that e.g. typing a word
+// produces a single undo step.
+const undoCoalesceWindow = 500 * time.Millisecond
+
+// FilterFunc reports whether rune r is allowed into an editor whose
+// current text is existing. It is consulted for every rune of every
+// insertion, with existing growing to include runes already accepted
+// earlier in the same insertion, so a filter with state that depends on
+// the field's contents (e.g. DecimalFilter counting digits after a
+// decimal point) can derive it from existing instead of tracking its
+// own keystroke history. Runes it rejects are dropped silently.
+type FilterFunc func(existing string, r rune) bool
+
+// Span is a byte range [Start, End) within Text() that a Highlighter
+// wants painted in Color. Bold is advisory for callers that shape a
+// bold variant of the editor's font themselves; PaintText does not
+// reshape glyphs to honor it. Spans should be returned in order and
+// non-overlapping.
+type Span struct {
+	Start, End int
+	Color      color.RGBA
+	Bold       bool
+}
+
+// Highlighter computes the Spans to color within text, e.g. for coloring
+// DCR addresses and txids in a console view or tokenizing JSON in a
+// raw-transaction inspector. It is only called again after the text
+// actually changes, so it may do as much work as the syntax warrants.
+type Highlighter interface {
+	Highlight(text string) []Span
+}
+
 type Event interface {
 	isEditorEvent()
 }
@@ -83,6 +190,12 @@ type SubmitEvent struct {
 }
 
 type line struct {
+	// idx is this shape's index into e.lines. lineIterator skips lines
+	// scrolled above the clip, so e.shapes is only the visible subset
+	// of e.lines and its position in e.shapes does not in general equal
+	// idx; code mapping a shape back to e.lines (byte ranges, spans)
+	// must use idx, not its range index.
+	idx    int
 	offset f32.Point
 	clip   op.CallOp
 }
@@ -115,6 +228,7 @@ func (e *Editor) makeValid() {
 	if !e.valid {
 		e.lines, e.dims = e.layoutText(e.shaper)
 		e.valid = true
+		e.car.line, e.car.col, e.car.x, e.car.y = e.layoutPos(e.rr.caret)
 	}
 }
 
@@ -147,12 +261,30 @@ func (e *Editor) processPointer(gtx *layout.Context) {
 				X: int(math.Round(float64(evt.Position.X))),
 				Y: int(math.Round(float64(evt.Position.Y))),
 			})
+			e.anchor = e.rr.caret
 			e.requestFocus = true
 			if e.scroller.State() != gesture.StateFlinging {
 				e.caretScroll = true
 			}
 		}
 	}
+	for _, evt := range e.dragger.Events(gtx) {
+		pos := image.Point{
+			X: int(math.Round(float64(evt.Position.X))),
+			Y: int(math.Round(float64(evt.Position.Y))),
+		}
+		switch evt.Type {
+		case gesture.TypePress:
+			e.blinkStart = gtx.Now()
+			e.moveCoord(pos)
+			e.anchor = e.rr.caret
+			e.requestFocus = true
+			e.caretScroll = true
+		case gesture.TypeDrag:
+			e.moveCoord(pos)
+			e.caretScroll = true
+		}
+	}
 	if (sdist > 0 && soff >= smax) || (sdist < 0 && soff <= smin) {
 		e.scroller.Stop()
 	}
@@ -161,6 +293,7 @@ func (e *Editor) processPointer(gtx *layout.Context) {
 func (e *Editor) processKey(gtx *layout.Context) {
 	if e.rr.Changed() {
 		e.events = append(e.events, ChangeEvent{})
+		e.spansValid = false
 	}
 	for _, ke := range gtx.Events(&e.eventKey) {
 		e.blinkStart = gtx.Now()
@@ -186,28 +319,76 @@ func (e *Editor) processKey(gtx *layout.Context) {
 		case key.EditEvent:
 			e.caretScroll = true
 			e.scroller.Stop()
+			e.deleteSelection()
+			e.append(ke.Text)
+		case clipboard.Event:
+			e.caretScroll = true
+			e.scroller.Stop()
+			e.deleteSelection()
 			e.append(ke.Text)
 		}
 		if e.rr.Changed() {
 			e.events = append(e.events, ChangeEvent{})
+			e.spansValid = false
 		}
 	}
+	if e.pasteRequested {
+		e.pasteRequested = false
+		clipboard.ReadOp{Tag: &e.eventKey}.Add(gtx.Ops)
+	}
+	if e.clipboardWrite != nil {
+		clipboard.WriteOp{Text: *e.clipboardWrite}.Add(gtx.Ops)
+		e.clipboardWrite = nil
+	}
 }
 
 func (e *Editor) command(k key.Event) bool {
+	// An EditEvent or clipboard.Event processed earlier in this same
+	// frame's event batch invalidates e.car without refreshing it
+	// (refresh is normally deferred to the next makeValid at the start
+	// of the following frame). Bring it up to date before the
+	// navigation commands below read it, so e.g. an Up arrow right
+	// after a paste doesn't use a stale line/x/y.
+	e.makeValid()
+	mod := k.Modifiers
+	if mod.Contain(key.ModCtrl) {
+		switch k.Name {
+		case "Z":
+			if mod.Contain(key.ModShift) {
+				e.Redo()
+			} else {
+				e.Undo()
+			}
+			return true
+		case "C":
+			e.Copy()
+			return true
+		case "X":
+			e.Copy()
+			e.deleteSelection()
+			return true
+		case "V":
+			e.Paste()
+			return true
+		}
+	}
+	extend := mod.Contain(key.ModShift)
 	switch k.Name {
 	case key.NameReturn, key.NameEnter:
+		e.deleteSelection()
 		e.append("\n")
 	case key.NameDeleteBackward:
-		e.Delete(-1)
+		if !e.deleteSelection() {
+			e.Delete(-1)
+		}
 	case key.NameDeleteForward:
-		e.Delete(1)
+		if !e.deleteSelection() {
+			e.Delete(1)
+		}
 	case key.NameUpArrow:
-		line, _, carX, _ := e.layoutCaret()
-		e.carXOff = e.moveToLine(carX+e.carXOff, line-1)
+		e.car.xoff = e.moveToLine(e.car.x+e.car.xoff, e.car.line-1)
 	case key.NameDownArrow:
-		line, _, carX, _ := e.layoutCaret()
-		e.carXOff = e.moveToLine(carX+e.carXOff, line+1)
+		e.car.xoff = e.moveToLine(e.car.x+e.car.xoff, e.car.line+1)
 	case key.NameLeftArrow:
 		e.Move(-1)
 	case key.NameRightArrow:
@@ -223,6 +404,9 @@ func (e *Editor) command(k key.Event) bool {
 	default:
 		return false
 	}
+	if !extend {
+		e.anchor = e.rr.caret
+	}
 	return true
 }
 
@@ -292,12 +476,12 @@ func (e *Editor) layout(gtx *layout.Context) {
 	}
 	e.shapes = e.shapes[:0]
 	for {
-		_, _, layout, off, ok := it.Next()
+		ln, _, layout, off, ok := it.Next()
 		if !ok {
 			break
 		}
 		path := e.shaper.Shape(e.font, e.textSize, layout)
-		e.shapes = append(e.shapes, line{off, path})
+		e.shapes = append(e.shapes, line{idx: ln, offset: off, clip: path})
 	}
 
 	key.InputOp{Key: &e.eventKey, Focus: e.requestFocus}.Add(gtx.Ops)
@@ -311,6 +495,7 @@ func (e *Editor) layout(gtx *layout.Context) {
 	pointer.Rect(r).Add(gtx.Ops)
 	e.scroller.Add(gtx.Ops)
 	e.clicker.Add(gtx.Ops)
+	e.dragger.Add(gtx.Ops)
 	e.caretOn = false
 	if e.focused {
 		now := gtx.Now()
@@ -328,10 +513,148 @@ func (e *Editor) layout(gtx *layout.Context) {
 	gtx.Dimensions = layout.Dimensions{Size: e.viewSize, Baseline: e.dims.Baseline}
 }
 
+// PaintSelection paints a SelectionColor rectangle behind the glyphs
+// covered by the active selection, one rectangle per line. It should be
+// called before PaintText so the text is drawn on top of the highlight.
+func (e *Editor) PaintSelection(gtx *layout.Context) {
+	start, end := e.selection()
+	if start == end {
+		return
+	}
+	startLine, _, startX, _ := e.layoutPos(start)
+	endLine, _, endX, _ := e.layoutPos(end)
+
+	var stack op.StackOp
+	stack.Push(gtx.Ops)
+	paint.ColorOp{Color: e.SelectionColor}.Add(gtx.Ops)
+	for ln := startLine; ln <= endLine; ln++ {
+		l := e.lines[ln]
+		x0 := align(e.Alignment, l.Width, e.viewSize.X)
+		x1 := x0 + l.Width
+		if ln == startLine {
+			x0 = startX
+		}
+		if ln == endLine {
+			x1 = endX
+		}
+		y := e.lineBaseline(ln)
+		carAsc, carDesc := -l.Bounds.Min.Y, l.Bounds.Max.Y
+		rect := image.Rectangle{
+			Min: image.Point{X: x0.Floor(), Y: y - carAsc.Ceil()},
+			Max: image.Point{X: x1.Ceil(), Y: y + carDesc.Ceil()},
+		}
+		rect = rect.Sub(e.scrollOff)
+		if !rect.Empty() {
+			paint.PaintOp{Rect: toRectF(rect)}.Add(gtx.Ops)
+		}
+	}
+	stack.Pop()
+}
+
+// SetHighlighter installs h as the source of Spans PaintText colors the
+// text with, replacing any previous Highlighter. A nil h (the default)
+// disables highlighting; PaintText then paints every line in the
+// caller's current color, as before.
+func (e *Editor) SetHighlighter(h Highlighter) {
+	e.highlighter = h
+	e.spansValid = false
+}
+
+// textSpans returns the cached Highlight spans for the current text,
+// recomputing them only when spansValid is false, i.e. only after an
+// actual edit rather than on every frame.
+func (e *Editor) textSpans() []Span {
+	if e.highlighter == nil {
+		return nil
+	}
+	if !e.spansValid {
+		e.spans = e.highlighter.Highlight(e.Text())
+		e.spansValid = true
+	}
+	return e.spans
+}
+
+// PaintText paints the shaped lines. If a Highlighter is set, each Span
+// it returns is painted in its own color by further clipping the line's
+// glyph shape to the span's horizontal extent, instead of one paint per
+// line.
 func (e *Editor) PaintText(gtx *layout.Context) {
 	clip := textPadding(e.lines)
 	clip.Max = clip.Max.Add(e.viewSize)
+	spans := e.textSpans()
+	if len(spans) == 0 {
+		for _, shape := range e.shapes {
+			var stack op.StackOp
+			stack.Push(gtx.Ops)
+			op.TransformOp{}.Offset(shape.offset).Add(gtx.Ops)
+			shape.clip.Add(gtx.Ops)
+			paint.PaintOp{Rect: toRectF(clip).Sub(shape.offset)}.Add(gtx.Ops)
+			stack.Pop()
+		}
+		return
+	}
+	// e.shapes only holds the lines lineIterator judged visible, which
+	// is a subset of e.lines whenever the editor is scrolled past its
+	// first line, so the byte offset of each shape's line has to come
+	// from its real e.lines index (shape.idx), not its position in
+	// e.shapes. lineStarts is computed once, not per shape, to keep
+	// that lookup off the per-span hot path.
+	lineStarts := make([]int, len(e.lines)+1)
+	for i, l := range e.lines {
+		lineStarts[i+1] = lineStarts[i] + l.Len
+	}
 	for _, shape := range e.shapes {
+		ln := shape.idx
+		if ln >= len(e.lines) {
+			break
+		}
+		e.paintLineSpans(gtx, ln, lineStarts[ln], shape, clip, spans)
+	}
+}
+
+// paintLineSpans paints e.lines[ln]'s glyphs, splitting its byte range
+// among the spans that intersect it, painting the runs before, between
+// and after those spans in the caller's current color, and falling back
+// to a single plain paint, as PaintText used to do for every line,
+// wherever no span covers the line. lineStart is the byte offset of e.lines[ln]'s first rune,
+// looked up by PaintText from its precomputed lineStarts so this
+// doesn't have to re-sum e.lines[:ln] itself.
+func (e *Editor) paintLineSpans(gtx *layout.Context, ln, lineStart int, shape line, clip image.Rectangle, spans []Span) {
+	lineEnd := lineStart + e.lines[ln].Len
+	painted := false
+	var offsets []int
+	var xs []fixed.Int26_6
+	// gapX is where the run of glyphs not yet covered by a span begins.
+	var gapX fixed.Int26_6
+	for _, sp := range spans {
+		start, end := sp.Start, sp.End
+		if end <= lineStart || start >= lineEnd {
+			continue
+		}
+		if start < lineStart {
+			start = lineStart
+		}
+		if end > lineEnd {
+			end = lineEnd
+		}
+		if offsets == nil {
+			// Computed once per line, not once per span: the x
+			// coordinate of every glyph boundary on the line, so
+			// mapping a span's start/end to pixels is a binary
+			// search instead of a re-walk of e.lines from the top.
+			offsets, xs = e.lineGlyphOffsets(ln, lineStart)
+			gapX = xs[0]
+		}
+		x0 := xs[glyphIndex(offsets, start)]
+		x1 := xs[glyphIndex(offsets, end)]
+		e.paintLineRange(gtx, shape, clip, gapX, x0, nil)
+		e.paintLineRange(gtx, shape, clip, x0, x1, &sp.Color)
+		gapX = x1
+		painted = true
+	}
+	if painted {
+		e.paintLineRange(gtx, shape, clip, gapX, xs[len(xs)-1], nil)
+	} else {
 		var stack op.StackOp
 		stack.Push(gtx.Ops)
 		op.TransformOp{}.Offset(shape.offset).Add(gtx.Ops)
@@ -341,6 +664,60 @@ func (e *Editor) PaintText(gtx *layout.Context) {
 	}
 }
 
+// lineGlyphOffsets returns, for e.lines[ln] starting at byte offset
+// lineStart, the byte offset and x coordinate at every glyph boundary
+// (including one past the last glyph), so that a span's start/end byte
+// offsets within the line can be mapped to pixels by binary search
+// rather than by re-walking e.lines from the top per lookup.
+func (e *Editor) lineGlyphOffsets(ln, lineStart int) ([]int, []fixed.Int26_6) {
+	l := e.lines[ln]
+	offsets := make([]int, len(l.Layout)+1)
+	xs := make([]fixed.Int26_6, len(l.Layout)+1)
+	a := align(e.Alignment, l.Width, e.viewSize.X)
+	idx := lineStart
+	var x fixed.Int26_6
+	for i, g := range l.Layout {
+		offsets[i] = idx
+		xs[i] = x + a
+		idx += utf8.RuneLen(g.Rune)
+		x += g.Advance
+	}
+	offsets[len(l.Layout)] = idx
+	xs[len(l.Layout)] = x + a
+	return offsets, xs
+}
+
+// glyphIndex returns the index into offsets (and the parallel xs from
+// lineGlyphOffsets) of byte offset pos via binary search.
+func glyphIndex(offsets []int, pos int) int {
+	return sort.Search(len(offsets), func(i int) bool { return offsets[i] >= pos })
+}
+
+// paintLineRange paints the glyphs of shape whose x coordinates fall in
+// [x0, x1) in col, or in the caller's current color if col is nil, by
+// intersecting clip with that pixel range shifted by the scroll offset.
+func (e *Editor) paintLineRange(gtx *layout.Context, shape line, clip image.Rectangle, x0, x1 fixed.Int26_6, col *color.RGBA) {
+	rect := clip
+	if v := x0.Ceil() - e.scrollOff.X; v > rect.Min.X {
+		rect.Min.X = v
+	}
+	if v := x1.Ceil() - e.scrollOff.X; v < rect.Max.X {
+		rect.Max.X = v
+	}
+	if rect.Min.X >= rect.Max.X {
+		return
+	}
+	var stack op.StackOp
+	stack.Push(gtx.Ops)
+	op.TransformOp{}.Offset(shape.offset).Add(gtx.Ops)
+	shape.clip.Add(gtx.Ops)
+	if col != nil {
+		paint.ColorOp{Color: *col}.Add(gtx.Ops)
+	}
+	paint.PaintOp{Rect: toRectF(rect).Sub(shape.offset)}.Add(gtx.Ops)
+	stack.Pop()
+}
+
 func (e *Editor) PaintCaret(gtx *layout.Context) {
 	if !e.caretOn {
 		return
@@ -390,10 +767,214 @@ func (e *Editor) Text() string {
 // SetText replaces the contents of the editor.
 func (e *Editor) SetText(s string) {
 	e.rr = editBuffer{}
-	e.carXOff = 0
+	e.car.xoff = 0
+	e.anchor = 0
+	e.undo = undo{}
+	if e.MaxLen > 0 {
+		s = truncateRunes(s, e.MaxLen)
+	}
 	e.prepend(s)
 }
 
+// SelectedText returns the text currently highlighted, or the empty
+// string if there is no active selection.
+func (e *Editor) SelectedText() string {
+	start, end := e.selection()
+	if start == end {
+		return ""
+	}
+	return e.Text()[start:end]
+}
+
+// SetSelection sets the active selection to the range [start, end),
+// clamping both ends to the bounds of the editor contents. start and end
+// are byte offsets into Text(), matching CaretPos's underlying units.
+func (e *Editor) SetSelection(start, end int) {
+	n := e.rr.len()
+	clamp := func(i int) int {
+		if i < 0 {
+			return 0
+		}
+		if i > n {
+			return n
+		}
+		return i
+	}
+	e.anchor = clamp(start)
+	e.rr.caret = clamp(end)
+	e.car.xoff = 0
+	e.invalidate()
+	e.caretScroll = true
+}
+
+// selection returns the active selection as an ordered [start, end)
+// byte range. start equals end when nothing is selected.
+func (e *Editor) selection() (start, end int) {
+	if e.anchor < e.rr.caret {
+		return e.anchor, e.rr.caret
+	}
+	return e.rr.caret, e.anchor
+}
+
+// deleteSelection removes the currently selected text, if any, leaving
+// the caret at the start of the former selection. It reports whether
+// there was a selection to delete.
+func (e *Editor) deleteSelection() bool {
+	start, end := e.selection()
+	if start == end {
+		return false
+	}
+	n := utf8.RuneCountInString(e.Text()[start:end])
+	e.recordDeleteRange(start, end)
+	e.rr.caret = end
+	e.rr.deleteRunes(-n)
+	e.anchor = e.rr.caret
+	e.car.xoff = 0
+	e.invalidate()
+	return true
+}
+
+// Copy copies the selected text, if any, to the system clipboard.
+func (e *Editor) Copy() {
+	if s := e.SelectedText(); s != "" {
+		e.clipboardWrite = &s
+	}
+}
+
+// Paste requests the system clipboard contents and, once delivered,
+// inserts them at the caret, replacing the active selection if any.
+func (e *Editor) Paste() {
+	e.pasteRequested = true
+}
+
+// Undo reverts the most recent coalesced edit, if any, and reports
+// whether an edit was reverted.
+func (e *Editor) Undo() bool {
+	if e.undo.pos == 0 {
+		return false
+	}
+	e.undo.pos--
+	r := e.undo.records[e.undo.pos]
+	e.applyEdit(r.start, r.after, r.before)
+	return true
+}
+
+// Redo reapplies the most recently undone edit, if any, and reports
+// whether an edit was reapplied.
+func (e *Editor) Redo() bool {
+	if e.undo.pos >= len(e.undo.records) {
+		return false
+	}
+	r := e.undo.records[e.undo.pos]
+	e.undo.pos++
+	e.applyEdit(r.start, r.before, r.after)
+	return true
+}
+
+// applyEdit replaces the bytes in [start, start+len(from)) with to,
+// without going through the undo-recording edit paths, and leaves the
+// caret immediately after the replacement.
+func (e *Editor) applyEdit(start int, from, to string) {
+	if from != "" {
+		e.rr.caret = start + len(from)
+		e.rr.deleteRunes(-utf8.RuneCountInString(from))
+	}
+	if to != "" {
+		e.rr.caret = start
+		e.prepend(to)
+	}
+	e.rr.caret = start + len(to)
+	e.anchor = e.rr.caret
+	e.car.xoff = 0
+	e.invalidate()
+}
+
+// recordInsert appends an undo record for inserting s at the caret,
+// coalescing it into the previous record when it directly continues a
+// recent insertion within undoCoalesceWindow.
+func (e *Editor) recordInsert(s string) {
+	now := e.blinkStart
+	if n := len(e.undo.records); n > 0 && e.undo.pos == n {
+		last := &e.undo.records[n-1]
+		if last.before == "" && last.start+len(last.after) == e.rr.caret && now.Sub(last.at) < undoCoalesceWindow {
+			last.after += s
+			last.at = now
+			return
+		}
+	}
+	e.appendUndoRecord(editRecord{start: e.rr.caret, after: s, at: now})
+}
+
+// recordDeleteRange appends an undo record covering the bytes about to
+// be removed in [start, end), coalescing it into the previous record
+// when it directly continues a recent deletion within undoCoalesceWindow.
+func (e *Editor) recordDeleteRange(start, end int) {
+	before := e.Text()[start:end]
+	now := e.blinkStart
+	if n := len(e.undo.records); n > 0 && e.undo.pos == n {
+		last := &e.undo.records[n-1]
+		if last.after == "" && now.Sub(last.at) < undoCoalesceWindow {
+			switch {
+			case last.start == end:
+				// Backspacing: new range sits immediately before the
+				// previous one.
+				last.start = start
+				last.before = before + last.before
+				last.at = now
+				return
+			case last.start == start:
+				// Forward-deleting: new range sits immediately after
+				// the caret, same as the previous one.
+				last.before += before
+				last.at = now
+				return
+			}
+		}
+	}
+	e.appendUndoRecord(editRecord{start: start, before: before, at: now})
+}
+
+// recordDelete appends an undo record for deleting runes runes from the
+// caret, delegating to recordDeleteRange for the coalescing logic.
+func (e *Editor) recordDelete(runes int) {
+	start, end := e.rr.caret, e.rr.caret
+	if runes < 0 {
+		pos := e.rr.caret
+		for i := 0; i < -runes; i++ {
+			_, s := e.rr.runeBefore(pos)
+			if s == 0 {
+				break
+			}
+			pos -= s
+		}
+		start = pos
+	} else {
+		pos := e.rr.caret
+		for i := 0; i < runes; i++ {
+			_, s := e.rr.runeAt(pos)
+			if s == 0 {
+				break
+			}
+			pos += s
+		}
+		end = pos
+	}
+	if start == end {
+		return
+	}
+	e.recordDeleteRange(start, end)
+}
+
+// appendUndoRecord pushes r onto the undo history, discarding any
+// previously undone records and trimming to maxUndoRecords.
+func (e *Editor) appendUndoRecord(r editRecord) {
+	e.undo.records = append(e.undo.records[:e.undo.pos], r)
+	if len(e.undo.records) > maxUndoRecords {
+		e.undo.records = e.undo.records[len(e.undo.records)-maxUndoRecords:]
+	}
+	e.undo.pos = len(e.undo.records)
+}
+
 func (e *Editor) scrollBounds() image.Rectangle {
 	var b image.Rectangle
 	if e.SingleLine {
@@ -489,6 +1070,13 @@ func (e *Editor) CaretCoords() (x fixed.Int26_6, y int) {
 }
 
 func (e *Editor) layoutCaret() (carLine, carCol int, x fixed.Int26_6, y int) {
+	return e.car.line, e.car.col, e.car.x, e.car.y
+}
+
+// layoutPos is the generalization of layoutCaret to an arbitrary byte
+// offset pos, used to locate the endpoints of a selection for
+// PaintSelection.
+func (e *Editor) layoutPos(pos int) (carLine, carCol int, x fixed.Int26_6, y int) {
 	var idx int
 	var prevDesc fixed.Int26_6
 loop:
@@ -496,9 +1084,9 @@ loop:
 		l := e.lines[carLine]
 		y += (prevDesc + l.Ascent).Ceil()
 		prevDesc = l.Descent
-		if carLine == len(e.lines)-1 || idx+len(l.Layout) > e.rr.caret {
+		if carLine == len(e.lines)-1 || idx+len(l.Layout) > pos {
 			for _, g := range l.Layout {
-				if idx == e.rr.caret {
+				if idx == pos {
 					break loop
 				}
 				x += g.Advance
@@ -513,6 +1101,20 @@ loop:
 	return
 }
 
+// lineBaseline returns the y coordinate of line's baseline, for use by
+// PaintSelection when it needs the vertical extent of lines that a
+// selection only partially covers.
+func (e *Editor) lineBaseline(line int) int {
+	var y int
+	var prevDesc fixed.Int26_6
+	for i := 0; i <= line; i++ {
+		l := e.lines[i]
+		y += (prevDesc + l.Ascent).Ceil()
+		prevDesc = l.Descent
+	}
+	return y
+}
+
 func (e *Editor) invalidate() {
 	e.valid = false
 }
@@ -520,8 +1122,9 @@ func (e *Editor) invalidate() {
 // Delete runes from the caret position. The sign of runes specifies the
 // direction to delete: positive is forward, negative is backward.
 func (e *Editor) Delete(runes int) {
+	e.recordDelete(runes)
 	e.rr.deleteRunes(runes)
-	e.carXOff = 0
+	e.car.xoff = 0
 	e.invalidate()
 }
 
@@ -536,18 +1139,61 @@ func (e *Editor) append(s string) {
 	if e.SingleLine {
 		s = strings.ReplaceAll(s, "\n", "")
 	}
+	if e.Filter != nil {
+		s = filterRunes(e.Text(), s, e.Filter)
+	}
+	if e.MaxLen > 0 {
+		if room := e.MaxLen - utf8.RuneCountInString(e.Text()); room <= 0 {
+			s = ""
+		} else {
+			s = truncateRunes(s, room)
+		}
+	}
+	if s == "" {
+		return
+	}
+	e.recordInsert(s)
 	e.prepend(s)
 	e.rr.caret += len(s)
+	e.anchor = e.rr.caret
+}
+
+// filterRunes drops the runes of s rejected by filter, in order,
+// judging each against existing plus whatever runes of s it has already
+// accepted.
+func filterRunes(existing, s string, filter FilterFunc) string {
+	var b strings.Builder
+	for _, r := range s {
+		if filter(existing, r) {
+			b.WriteRune(r)
+			existing += string(r)
+		}
+	}
+	return b.String()
+}
+
+// truncateRunes returns the first n runes of s.
+func truncateRunes(s string, n int) string {
+	var b strings.Builder
+	i := 0
+	for _, r := range s {
+		if i >= n {
+			break
+		}
+		b.WriteRune(r)
+		i++
+	}
+	return b.String()
 }
 
 func (e *Editor) prepend(s string) {
 	e.rr.prepend(s)
-	e.carXOff = 0
+	e.car.xoff = 0
 	e.invalidate()
 }
 
 func (e *Editor) movePages(pages int) {
-	_, _, carX, carY := e.layoutCaret()
+	carX, carY := e.car.x, e.car.y
 	y := carY + pages*e.viewSize.Y
 	var (
 		prevDesc fixed.Int26_6
@@ -567,11 +1213,14 @@ func (e *Editor) movePages(pages int) {
 		y2 += h
 		carLine2++
 	}
-	e.carXOff = e.moveToLine(carX+e.carXOff, carLine2)
+	e.car.xoff = e.moveToLine(carX+e.car.xoff, carLine2)
 }
 
+// moveToLine moves the caret to the rune on line carLine2 closest to
+// carX, and leaves e.car updated to match, without re-walking the lines
+// before the caret's current line.
 func (e *Editor) moveToLine(carX fixed.Int26_6, carLine2 int) fixed.Int26_6 {
-	carLine, carCol, _, _ := e.layoutCaret()
+	carLine, carCol, y := e.car.line, e.car.col, e.car.y
 	if carLine2 < 0 {
 		carLine2 = 0
 	}
@@ -588,10 +1237,12 @@ func (e *Editor) moveToLine(carX fixed.Int26_6, carLine2 int) fixed.Int26_6 {
 		if carLine2 > carLine {
 			for i := carLine; i < carLine2; i++ {
 				e.rr.caret += e.lines[i].Len
+				y += (e.lines[i].Descent + e.lines[i+1].Ascent).Ceil()
 			}
 		} else {
 			for i := carLine - 1; i >= carLine2; i-- {
 				e.rr.caret -= e.lines[i].Len
+				y -= (e.lines[i].Descent + e.lines[i+1].Ascent).Ceil()
 			}
 		}
 	}
@@ -603,6 +1254,7 @@ func (e *Editor) moveToLine(carX fixed.Int26_6, carLine2 int) fixed.Int26_6 {
 		end = 1
 	}
 	// Move to rune closest to previous horizontal position.
+	col2 := 0
 	for i := 0; i < len(l2.Layout)-end; i++ {
 		g := l2.Layout[i]
 		if carX2 >= carX {
@@ -614,30 +1266,104 @@ func (e *Editor) moveToLine(carX fixed.Int26_6, carLine2 int) fixed.Int26_6 {
 		carX2 += g.Advance
 		_, s := e.rr.runeAt(e.rr.caret)
 		e.rr.caret += s
+		col2++
 	}
+	e.car.line = carLine2
+	e.car.col = col2
+	e.car.x = carX2
+	e.car.y = y
 	return carX - carX2
 }
 
-// Move the caret: positive distance moves forward, negative distance moves
-// backward.
+// Move the caret: positive distance moves forward, negative distance
+// moves backward. e.car is advanced one rune at a time alongside
+// e.rr.caret, rather than being recomputed from scratch afterwards.
 func (e *Editor) Move(distance int) {
-	e.rr.move(distance)
-	e.carXOff = 0
+	for ; distance < 0; distance++ {
+		if !e.stepCaret(-1) {
+			break
+		}
+	}
+	for ; distance > 0; distance-- {
+		if !e.stepCaret(1) {
+			break
+		}
+	}
+	e.car.xoff = 0
+}
+
+// stepCaret moves e.rr.caret and e.car by one rune in the given
+// direction (-1 or 1), crossing into the neighbouring line when the
+// current line is exhausted. It reports whether a rune was available.
+func (e *Editor) stepCaret(dir int) bool {
+	if dir < 0 {
+		_, s := e.rr.runeBefore(e.rr.caret)
+		if s == 0 {
+			return false
+		}
+		e.rr.caret -= s
+		if e.car.col > 0 {
+			e.car.col--
+			e.car.x -= e.lines[e.car.line].Layout[e.car.col].Advance
+		} else if e.car.line > 0 {
+			e.car.line--
+			l := e.lines[e.car.line]
+			e.car.col = len(l.Layout)
+			if e.car.col > 0 {
+				e.car.col--
+			}
+			e.car.x = align(e.Alignment, l.Width, e.viewSize.X) + lineAdvanceSum(l, e.car.col)
+			e.car.y -= (l.Descent + e.lines[e.car.line+1].Ascent).Ceil()
+		}
+		return true
+	}
+	_, s := e.rr.runeAt(e.rr.caret)
+	if s == 0 {
+		return false
+	}
+	e.rr.caret += s
+	end := 0
+	if e.car.line < len(e.lines)-1 {
+		end = 1
+	}
+	if e.car.col < len(e.lines[e.car.line].Layout)-end {
+		e.car.x += e.lines[e.car.line].Layout[e.car.col].Advance
+		e.car.col++
+	} else if e.car.line < len(e.lines)-1 {
+		e.car.line++
+		l := e.lines[e.car.line]
+		e.car.col = 0
+		e.car.x = align(e.Alignment, l.Width, e.viewSize.X)
+		e.car.y += (e.lines[e.car.line-1].Descent + l.Ascent).Ceil()
+	}
+	return true
+}
+
+// lineAdvanceSum sums the glyph advances of l.Layout[:col], the distance
+// from the line's start to column col.
+func lineAdvanceSum(l text.Line, col int) fixed.Int26_6 {
+	var x fixed.Int26_6
+	for i := 0; i < col; i++ {
+		x += l.Layout[i].Advance
+	}
+	return x
 }
 
 func (e *Editor) moveStart() {
-	carLine, carCol, x, _ := e.layoutCaret()
+	carLine, carCol, x := e.car.line, e.car.col, e.car.x
 	layout := e.lines[carLine].Layout
 	for i := carCol - 1; i >= 0; i-- {
 		_, s := e.rr.runeBefore(e.rr.caret)
 		e.rr.caret -= s
 		x -= layout[i].Advance
 	}
-	e.carXOff = -x
+	e.car.col = 0
+	e.car.x = x
+	e.car.xoff = -x
 }
 
 func (e *Editor) moveEnd() {
-	carLine, carCol, x, _ := e.layoutCaret()
+	carLine, carCol, x := e.car.line, e.car.col, e.car.x
 	l := e.lines[carLine]
 	// Only move past the end of the last line
 	end := 0
@@ -645,14 +1371,18 @@ func (e *Editor) moveEnd() {
 		end = 1
 	}
 	layout := l.Layout
+	col := carCol
 	for i := carCol; i < len(layout)-end; i++ {
 		adv := layout[i].Advance
 		_, s := e.rr.runeAt(e.rr.caret)
 		e.rr.caret += s
 		x += adv
+		col++
 	}
 	a := align(e.Alignment, l.Width, e.viewSize.X)
-	e.carXOff = l.Width + a - x
+	e.car.col = col
+	e.car.x = x
+	e.car.xoff = l.Width + a - x
 }
 
 func (e *Editor) scrollToCaret() {
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package editor
+
+import "strings"
+
+// DigitFilter accepts ASCII digits only, for fields such as whole-unit
+// amounts that should never contain letters or punctuation.
+func DigitFilter(existing string, r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// DecimalFilter returns a Filter accepting ASCII digits and a single
+// decimal point, rejecting digits past precision places after the
+// point. It judges each rune against existing, the editor's current
+// text, rather than against keystroke order, so it stays correct
+// through backspaces, undo and SetText. It does not know where in
+// existing a rune is inserted: once precision digits follow the point
+// it rejects every further digit, including one inserted before the
+// point, and it accepts a point inserted into the middle of a run of
+// digits even if more than precision digits then follow it.
+func DecimalFilter(precision int) FilterFunc {
+	return func(existing string, r rune) bool {
+		switch {
+		case r >= '0' && r <= '9':
+			if i := strings.IndexByte(existing, '.'); i >= 0 {
+				if len(existing)-i-1 >= precision {
+					return false
+				}
+			}
+			return true
+		case r == '.':
+			return !strings.ContainsRune(existing, '.')
+		default:
+			return false
+		}
+	}
+}
+
+// HexFilter accepts ASCII hex digits, for fields such as pasted
+// transaction IDs or raw hex-encoded data.
+func HexFilter(existing string, r rune) bool {
+	switch {
+	case r >= '0' && r <= '9':
+		return true
+	case r >= 'a' && r <= 'f':
+		return true
+	case r >= 'A' && r <= 'F':
+		return true
+	default:
+		return false
+	}
+}
+
+// AsciiPrintableFilter accepts printable ASCII characters, rejecting
+// control characters and anything outside the ASCII range.
+func AsciiPrintableFilter(existing string, r rune) bool {
+	return r >= 0x20 && r < 0x7f
+}
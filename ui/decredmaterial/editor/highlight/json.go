@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package highlight
+
+import (
+	"image/color"
+
+	"github.com/raedahgroup/godcr-gio/ui/decredmaterial/editor"
+)
+
+// Default colors used by JSONHighlighter.
+var (
+	JSONKeyColor    = color.RGBA{R: 0x9c, G: 0x27, B: 0xb0, A: 0xff}
+	JSONStringColor = color.RGBA{R: 0x2e, G: 0x7d, B: 0x32, A: 0xff}
+	JSONNumberColor = color.RGBA{R: 0x19, G: 0x76, B: 0xd2, A: 0xff}
+	JSONPunctColor  = color.RGBA{R: 0x75, G: 0x75, B: 0x75, A: 0xff}
+)
+
+// JSONHighlighter is an editor.Highlighter that tokenizes raw JSON text
+// into keys, string values, numbers and punctuation, for use in the
+// raw-transaction inspector. It does not validate the JSON; malformed
+// input is simply highlighted on a best-effort basis.
+type JSONHighlighter struct{}
+
+// Highlight implements editor.Highlighter.
+func (JSONHighlighter) Highlight(text string) []editor.Span {
+	var spans []editor.Span
+	i := 0
+	for i < len(text) {
+		switch c := text[i]; {
+		case c == '"':
+			start := i
+			i++
+			for i < len(text) && text[i] != '"' {
+				if text[i] == '\\' && i+1 < len(text) {
+					i++
+				}
+				i++
+			}
+			if i < len(text) {
+				i++
+			}
+			col := JSONStringColor
+			if isKeyToken(text, i) {
+				col = JSONKeyColor
+			}
+			spans = append(spans, editor.Span{Start: start, End: i, Color: col})
+		case c == '-' || (c >= '0' && c <= '9'):
+			start := i
+			i++
+			for i < len(text) && isNumberByte(text[i]) {
+				i++
+			}
+			spans = append(spans, editor.Span{Start: start, End: i, Color: JSONNumberColor})
+		case c == '{' || c == '}' || c == '[' || c == ']' || c == ':' || c == ',':
+			spans = append(spans, editor.Span{Start: i, End: i + 1, Color: JSONPunctColor})
+			i++
+		default:
+			i++
+		}
+	}
+	return spans
+}
+
+// isKeyToken reports whether the token ending at end (exclusive) is
+// followed, after optional whitespace, by a colon, i.e. whether it is an
+// object key rather than a string value.
+func isKeyToken(text string, end int) bool {
+	for end < len(text) {
+		switch text[end] {
+		case ' ', '\t', '\n', '\r':
+			end++
+		case ':':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func isNumberByte(b byte) bool {
+	switch b {
+	case '.', 'e', 'E', '+', '-':
+		return true
+	}
+	return b >= '0' && b <= '9'
+}
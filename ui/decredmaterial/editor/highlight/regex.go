@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+// Package highlight provides editor.Highlighter implementations for
+// coloring text in editor.Editor, such as DCR addresses and txids in
+// console/log views or JSON in the raw-transaction inspector.
+package highlight
+
+import (
+	"image/color"
+	"regexp"
+	"sort"
+
+	"github.com/raedahgroup/godcr-gio/ui/decredmaterial/editor"
+)
+
+// Rule colors every match of Pattern in Color.
+type Rule struct {
+	Pattern *regexp.Regexp
+	Color   color.RGBA
+}
+
+// RegexHighlighter is an editor.Highlighter that colors text by matching
+// a fixed list of Rules against it, in order. Rules earlier in the list
+// take priority where matches would otherwise overlap.
+type RegexHighlighter struct {
+	Rules []Rule
+}
+
+// NewRegexHighlighter returns a RegexHighlighter applying rules in
+// order, useful for coloring addresses, txids and amounts in
+// console/log views.
+func NewRegexHighlighter(rules ...Rule) *RegexHighlighter {
+	return &RegexHighlighter{Rules: rules}
+}
+
+// Highlight implements editor.Highlighter.
+func (h *RegexHighlighter) Highlight(text string) []editor.Span {
+	var spans []editor.Span
+	covered := make([]bool, len(text))
+	for _, rule := range h.Rules {
+		for _, loc := range rule.Pattern.FindAllStringIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if rangeCovered(covered, start, end) {
+				continue
+			}
+			for i := start; i < end; i++ {
+				covered[i] = true
+			}
+			spans = append(spans, editor.Span{Start: start, End: end, Color: rule.Color})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start < spans[j].Start
+	})
+	return spans
+}
+
+// rangeCovered reports whether any byte in [start, end) is already
+// claimed by an earlier, higher-priority rule.
+func rangeCovered(covered []bool, start, end int) bool {
+	for i := start; i < end; i++ {
+		if covered[i] {
+			return true
+		}
+	}
+	return false
+}
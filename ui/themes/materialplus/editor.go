@@ -0,0 +1,73 @@
+package materialplus
+
+import (
+	"image"
+
+	"gioui.org/gesture"
+	"gioui.org/layout"
+	"gioui.org/unit"
+
+	"github.com/raedahgroup/godcr-gio/ui/decredmaterial/editor"
+	"github.com/raedahgroup/godcr-gio/ui/values"
+)
+
+// eyeToggle is the small clickable icon that flips a masked Editor
+// between hidden and revealed.
+type eyeToggle struct {
+	clicker gesture.Click
+	shown   bool
+}
+
+// Layout draws the toggle and, on a click this frame, flips ed.Mask
+// between 0 (revealed) and hideMask (hidden).
+func (t *eyeToggle) Layout(gtx *layout.Context, ed *editor.Editor, hideMask rune) {
+	for range t.clicker.Events(gtx) {
+		t.shown = !t.shown
+		if t.shown {
+			ed.Mask = 0
+		} else {
+			ed.Mask = hideMask
+		}
+	}
+	size := gtx.Px(unit.Dp(20))
+	col := values.IconColorGray
+	if t.shown {
+		col = values.IconColorGreen
+	}
+	borderedRectangle(gtx, col, size, size)
+	t.clicker.Add(gtx.Ops)
+	gtx.Dimensions = layout.Dimensions{Size: image.Point{X: size, Y: size}}
+}
+
+// PasswordReveal is the eye-icon toggle returned alongside a
+// PasswordEditor. Layout must be called every frame the editor is
+// visible so it can react to clicks and keep ed.Mask in sync.
+type PasswordReveal struct {
+	toggle   eyeToggle
+	hideMask rune
+}
+
+// Layout lays out the eye icon for ed.
+func (r *PasswordReveal) Layout(gtx *layout.Context, ed *editor.Editor) {
+	r.toggle.Layout(gtx, ed, r.hideMask)
+}
+
+// PasswordEditor returns an editor.Editor masked with a bullet character
+// by default, and the PasswordReveal toggle that shows or hides it, so
+// passphrase fields no longer have to manage Mask by hand.
+func (t *Theme) PasswordEditor() (*editor.Editor, *PasswordReveal) {
+	const hideMask = '•'
+	ed := &editor.Editor{
+		Mask: hideMask,
+	}
+	return ed, &PasswordReveal{hideMask: hideMask}
+}
+
+// FilteredEditor returns an editor.Editor that only accepts runes
+// filter lets through, for fields such as amounts or addresses that
+// previously validated the whole string after every keystroke.
+func (t *Theme) FilteredEditor(filter editor.FilterFunc) *editor.Editor {
+	return &editor.Editor{
+		Filter: filter,
+	}
+}
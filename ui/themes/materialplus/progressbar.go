@@ -1,10 +1,14 @@
 package materialplus
 
 import (
+	"image"
 	"image/color"
+	"time"
 
 	"gioui.org/f32"
+	"gioui.org/io/pointer"
 	"gioui.org/layout"
+	"gioui.org/op"
 	"gioui.org/op/clip"
 
 	"github.com/raedahgroup/godcr-gio/ui/values"
@@ -16,6 +20,29 @@ type ProgressBar struct {
 	Height          int
 	BackgroundColor color.RGBA
 	ProgressColor   color.RGBA
+
+	// Segments are the phases MultiLayout draws as a multi-phase
+	// breakdown (e.g. sync headers/cfilters/address-discovery/rescan, or
+	// live/immature/locked/spendable stake balances), in place of the
+	// single ProgressColor bar that Layout draws.
+	Segments []Segment
+	// Indeterminate animates a shimmer band across the track instead of
+	// drawing Segments, for use while total progress is unknown.
+	Indeterminate bool
+
+	// hovered is one more than the index of the segment under the
+	// pointer, so that its zero value means no segment is hovered.
+	hovered      int
+	shimmerStart time.Time
+}
+
+// Segment is one phase of a segmented ProgressBar. It occupies Value
+// percent of the bar's width, drawn in Color, and identified by Label
+// for HoveredSegment's tooltip support.
+type Segment struct {
+	Value float64
+	Color color.RGBA
+	Label string
 }
 
 // track lays out a rectangle to represent the level of progress yet to be completed.
@@ -66,4 +93,141 @@ func (t *Theme) ProgressBar() *ProgressBar {
 		BackgroundColor: values.ProgressBarGray,
 		ProgressColor:   values.ProgressBarGreen,
 	}
+}
+
+// SegmentedProgressBar returns a new ProgressBar with sensible default
+// colors, ready to have its Segments field populated with the phases or
+// balance buckets the caller wants to break progress down into.
+func (t *Theme) SegmentedProgressBar() *ProgressBar {
+	return &ProgressBar{
+		Height:          values.DefaultProgressBarHeight,
+		BackgroundColor: values.ProgressBarGray,
+		ProgressColor:   values.ProgressBarGreen,
+	}
+}
+
+// MultiLayout lays out p.Segments as adjacent rectangles spanning the
+// track, rounding only the outermost corners so the segments read as a
+// single continuous pill. If p.Indeterminate is set, a shimmer band is
+// animated across the track instead.
+func (p *ProgressBar) MultiLayout(gtx *layout.Context) {
+	width := gtx.Constraints.Width.Max
+	p.processHover(gtx, width)
+
+	layout.Stack{}.Layout(gtx,
+		layout.Stacked(func() {
+			p.track(gtx)
+			switch {
+			case p.Indeterminate:
+				p.shimmer(gtx, width)
+			default:
+				p.segments(gtx, width)
+			}
+			pointer.Rect(image.Rectangle{Max: image.Point{X: width, Y: p.Height}}).Add(gtx.Ops)
+			pointer.InputOp{Tag: p, Types: pointer.Move | pointer.Enter | pointer.Leave}.Add(gtx.Ops)
+		}),
+	)
+}
+
+// segments draws each of p.Segments left to right, in order, so that
+// together they span width.
+func (p *ProgressBar) segments(gtx *layout.Context, width int) {
+	var x int
+	for i, seg := range p.Segments {
+		w := int(seg.Value / 100 * float64(width))
+		if i == len(p.Segments)-1 {
+			// Absorb rounding error into the last segment so the
+			// segments always total exactly width.
+			w = width - x
+		}
+		segmentRect(gtx, seg.Color, x, w, p.Height, i == 0, i == len(p.Segments)-1)
+		x += w
+	}
+}
+
+// segmentRect draws one Segment's rectangle at horizontal offset x with
+// width w, rounding its corners only when first or last is true — the
+// corners at the very start or end of the whole bar.
+func segmentRect(gtx *layout.Context, col color.RGBA, x, w, h int, first, last bool) {
+	var stack op.StackOp
+	stack.Push(gtx.Ops)
+	op.TransformOp{}.Offset(f32.Point{X: float32(x)}).Add(gtx.Ops)
+	br := float32(h / 5)
+	var ne, nw, se, sw float32
+	if first {
+		nw, sw = br, br
+	}
+	if last {
+		ne, se = br, br
+	}
+	rect := f32.Rectangle{Max: f32.Point{X: float32(w), Y: float32(h)}}
+	clip.Rect{Rect: rect, NE: ne, NW: nw, SE: se, SW: sw}.Op(gtx.Ops).Add(gtx.Ops)
+	Fill(gtx, col, w, h)
+	stack.Pop()
+}
+
+// shimmer animates a ProgressColor band sweeping across the track at
+// roughly 60fps via repeated op.InvalidateOp, for use while total
+// progress is unknown.
+func (p *ProgressBar) shimmer(gtx *layout.Context, width int) {
+	now := gtx.Now()
+	if p.shimmerStart.IsZero() {
+		p.shimmerStart = now
+	}
+	const period = 1200 * time.Millisecond
+	bandWidth := width / 4
+	if bandWidth < 1 {
+		bandWidth = 1
+	}
+	elapsed := now.Sub(p.shimmerStart) % period
+	x := int(float64(elapsed)/float64(period)*float64(width+bandWidth)) - bandWidth
+
+	var stack op.StackOp
+	stack.Push(gtx.Ops)
+	op.TransformOp{}.Offset(f32.Point{X: float32(x)}).Add(gtx.Ops)
+	borderedRectangle(gtx, p.ProgressColor, bandWidth, p.Height)
+	stack.Pop()
+
+	op.InvalidateOp{At: now.Add(time.Second / 60)}.Add(gtx.Ops)
+}
+
+// processHover updates the hovered segment index from this frame's
+// pointer events over the bar.
+func (p *ProgressBar) processHover(gtx *layout.Context, width int) {
+	for _, evt := range gtx.Events(p) {
+		pe, ok := evt.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch pe.Type {
+		case pointer.Move, pointer.Enter:
+			p.hovered = p.segmentAt(int(pe.Position.X), width) + 1
+		case pointer.Leave:
+			p.hovered = 0
+		}
+	}
+}
+
+// segmentAt returns the index of the segment occupying x within a bar
+// of the given width, or -1 if x falls outside every segment.
+func (p *ProgressBar) segmentAt(x, width int) int {
+	var acc float64
+	for i, seg := range p.Segments {
+		w := seg.Value / 100 * float64(width)
+		if float64(x) < acc+w {
+			return i
+		}
+		acc += w
+	}
+	return -1
+}
+
+// HoveredSegment returns the segment currently under the pointer and
+// true, so a caller can draw a tooltip with its Label and percentage.
+// It returns the zero Segment and false when nothing is hovered.
+func (p *ProgressBar) HoveredSegment() (Segment, bool) {
+	if p.hovered <= 0 || p.hovered > len(p.Segments) {
+		return Segment{}, false
+	}
+	return p.Segments[p.hovered-1], true
 }
\ No newline at end of file